@@ -0,0 +1,157 @@
+// Package client implements the write side of the Redmine REST API:
+// creating and updating issues, adding notes, and uploading attachments.
+// It complements the redminesync package, which only reads.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/miku/redminesync"
+)
+
+// Client talks to the write endpoints of a Redmine instance.
+type Client struct {
+	BaseURL string
+	APIKey  string
+
+	HTTPClient *http.Client
+}
+
+// New creates a Client for the given Redmine instance.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// Upload is a reference to a previously uploaded file, attached to an issue
+// on create or update via the "uploads" field.
+type Upload struct {
+	Token       string `json:"token"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// IssueFields holds the subset of issue attributes settable through the
+// write API. Zero-valued fields are omitted from the request body, so a
+// partial IssueFields only touches the fields it sets.
+type IssueFields struct {
+	ProjectId   int64    `json:"project_id,omitempty"`
+	TrackerId   int64    `json:"tracker_id,omitempty"`
+	StatusId    int64    `json:"status_id,omitempty"`
+	PriorityId  int64    `json:"priority_id,omitempty"`
+	Subject     string   `json:"subject,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Uploads     []Upload `json:"uploads,omitempty"`
+}
+
+// uploadResponse is returned by POST /uploads.json.
+type uploadResponse struct {
+	Upload struct {
+		Token string `json:"token"`
+		Id    int64  `json:"id"`
+	} `json:"upload"`
+}
+
+// UploadFile performs the first step of a two-step attachment upload: it
+// streams the file's contents to POST /uploads.json and returns the token
+// to reference it with in a subsequent CreateIssue/UpdateIssue call.
+func (c *Client) UploadFile(path string) (Upload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer f.Close()
+
+	link := fmt.Sprintf("%s/uploads.json", c.BaseURL)
+	req, err := http.NewRequest("POST", link, f)
+	if err != nil {
+		return Upload{}, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Redmine-API-Key", c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return Upload{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return Upload{}, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	var result uploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Upload{}, err
+	}
+	return Upload{
+		Token:       result.Upload.Token,
+		Filename:    filepath.Base(path),
+		ContentType: "application/octet-stream",
+	}, nil
+}
+
+// CreateIssue creates a new issue via POST /issues.json and returns the
+// created issue as returned by the server.
+func (c *Client) CreateIssue(fields IssueFields) (*redminesync.IssueResponse, error) {
+	var issue redminesync.IssueResponse
+	if err := c.doIssueRequest("POST", fmt.Sprintf("%s/issues.json", c.BaseURL), fields, &issue); err != nil {
+		return nil, err
+	}
+	return &issue, nil
+}
+
+// UpdateIssue updates an existing issue via PUT /issues/<id>.json. Redmine
+// returns no body on a successful update.
+func (c *Client) UpdateIssue(id int64, fields IssueFields) error {
+	link := fmt.Sprintf("%s/issues/%d.json", c.BaseURL, id)
+	return c.doIssueRequest("PUT", link, fields, nil)
+}
+
+// AddNote appends a note (journal entry) to an existing issue. It is a thin
+// wrapper around UpdateIssue that only sets the notes field.
+func (c *Client) AddNote(id int64, note string) error {
+	return c.UpdateIssue(id, IssueFields{Notes: note})
+}
+
+// doIssueRequest wraps fields in the {"issue": ...} envelope Redmine
+// expects, sends it as method to link, and decodes the response into out if
+// given.
+func (c *Client) doIssueRequest(method, link string, fields IssueFields, out interface{}) error {
+	body, err := json.Marshal(struct {
+		Issue IssueFields `json:"issue"`
+	}{Issue: fields})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, link, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Redmine-API-Key", c.APIKey)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("bad status: %s", resp.Status)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
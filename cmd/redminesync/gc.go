@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/miku/redminesync"
+	log "github.com/sirupsen/logrus"
+)
+
+// runGC removes store objects no longer referenced by any issue manifest
+// (symlink) under the sync directory.
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	syncDir := fs.String("d", filepath.Join(xdg.CacheHome, ".redminesync"), "sync directory")
+	verbose := fs.Bool("verbose", false, "list removed objects")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "redminesync gc [-d DIRECTORY] [-verbose]\n\nRemoves store objects no longer referenced by any issue.\n")
+	}
+	fs.Parse(args)
+
+	store := redminesync.NewObjectStore(filepath.Join(*syncDir, "objects"))
+	removed, err := store.GC(*syncDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *verbose {
+		for _, path := range removed {
+			log.Printf("removed: %s", path)
+		}
+	}
+	log.Printf("removed %d unreferenced object(s)", len(removed))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miku/redminesync"
+	"github.com/miku/redminesync/client"
+	log "github.com/sirupsen/logrus"
+)
+
+// runPush round-trips a locally edited issue.json (as produced by
+// redminesync sync -include issues) back to the server: an issue
+// with an id is updated in place, one without is created.
+func runPush(args []string) {
+	fs := flag.NewFlagSet("push", flag.ExitOnError)
+	apiKey := fs.String("k", os.Getenv("REDMINE_API_KEY"), "redmine API key possible from envvar REDMINE_API_KEY")
+	baseURL := fs.String("b", os.Getenv("REDMINE_BASE_URL"), "base URL")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "redminesync push [-k apikey] [-b URL] <issue.json>\n\nCreates or updates an issue from a locally edited issue.json.\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *apiKey == "" {
+		log.Fatal("REDMINE_API_KEY not defined and -k not given")
+	}
+	if *baseURL == "" {
+		log.Fatal("REDMINE_BASE_URL not defined and -b not given")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	var doc redminesync.IssueResponse
+	if err := json.NewDecoder(f).Decode(&doc); err != nil {
+		log.Fatalf("decode %s: %s", fs.Arg(0), err)
+	}
+
+	fields := client.IssueFields{
+		ProjectId:   doc.Issue.Project.Id,
+		TrackerId:   doc.Issue.Tracker.Id,
+		StatusId:    doc.Issue.Status.Id,
+		PriorityId:  doc.Issue.Priority.Id,
+		Subject:     doc.Issue.Subject,
+		Description: doc.Issue.Description,
+	}
+
+	c := client.New(*baseURL, *apiKey)
+	if doc.Issue.Id == 0 {
+		created, err := c.CreateIssue(fields)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("created issue %d", created.Issue.Id)
+	} else {
+		if err := c.UpdateIssue(doc.Issue.Id, fields); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("updated issue %d", doc.Issue.Id)
+	}
+}
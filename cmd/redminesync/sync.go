@@ -0,0 +1,194 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"github.com/miku/redminesync"
+	"github.com/schollz/progressbar"
+	log "github.com/sirupsen/logrus"
+)
+
+// runSync implements the default subcommand: mirroring attachments (and
+// optionally full issue/wiki/project/version data) from Redmine into a
+// local directory.
+func runSync(args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+
+	defaultSyncDir := filepath.Join(xdg.CacheHome, ".redminesync")
+	defaultAPIKey := os.Getenv("REDMINE_API_KEY")
+	defaultBaseURL := os.Getenv("REDMINE_BASE_URL")
+
+	startIssueNumber := fs.Int("f", 0, "start issue number, implies -full")
+	endIssueNumber := fs.Int("t", 0, "end issue number, 0 means automatically find the max issue number")
+	syncDir := fs.String("d", defaultSyncDir, "sync directory")
+	apiKey := fs.String("k", defaultAPIKey, "redmine API key possible from envvar REDMINE_API_KEY")
+	baseURL := fs.String("b", defaultBaseURL, "base URL")
+	concurrency := fs.Int("c", 4, "number of concurrent issue/attachment downloads")
+	full := fs.Bool("full", false, "force a full rescan, ignoring saved state")
+	since := fs.String("since", "", "only consider issues updated at or after this RFC3339 timestamp")
+	include := fs.String("include", "", "comma-separated resource kinds to archive in full (issues,wiki,projects,versions,users)")
+	verbose := fs.Bool("verbose", false, "verbose output")
+	showProgress := fs.Bool("P", false, "show progressbar")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, `redminesync [sync] [-k apikey] [-b URL] [-f ID] [-t ID] [-d DIRECTORY] [-c N] [-full] [-since TIME] [-verbose] [-P]
+
+Downloads all reachable attachments from redmine into a local folder. The
+target folder structure will look like:
+
+    %s/123/456/file.txt
+
+Where 123 is the issue number and 456 the download id. These paths are
+symlinks into a content-addressable object store under
+<DIRECTORY>/objects/sha256/, so attachments shared across many issues are
+only stored once; see "redminesync verify" and "redminesync gc".
+
+  -b URL          redmine base url [%s]
+  -k KEY          redmine api key [%s]
+  -d DIRECTORY    target directory [%s]
+  -f INT          start with this issue number, might shorten the process (implies -full)
+  -t INT          end with this issue number, might shorten the process (implies -full)
+  -c INT          number of concurrent issue/attachment downloads [4]
+  -full           force a full rescan of all issues, ignoring saved state
+  -since TIME     only consider issues updated at or after this RFC3339 timestamp
+  -include LIST   comma-separated resource kinds to archive in full: issues,wiki,projects,versions,users
+  -verbose        be verbose
+  -P              show progressbar
+
+  -include writes a full offline archive beyond attachments: issue.json per
+  issue (journals, changesets, custom fields, relations, watchers), and
+  project/wiki/version/user metadata. Without -include, only attachments are
+  mirrored, as before.
+
+By default only issues updated since the last successful run are fetched, using
+a small state database kept in the sync directory. Use -full for the first run
+or to force a complete rescan.
+
+Other subcommands:
+
+  redminesync push <issue.json>          create or update an issue from a local file
+  redminesync upload -issue N <file>      upload a file and attach it to issue N
+  redminesync verify                     re-hash the object store and report any bit-rot
+  redminesync gc                         remove objects no longer referenced by any issue
+
+Environment variables: REDMINE_API_KEY, REDMINE_BASE_URL
+
+`, defaultSyncDir, defaultBaseURL, defaultAPIKey, defaultSyncDir)
+	}
+	fs.Parse(args)
+
+	if *apiKey == "" {
+		log.Fatal("REDMINE_API_KEY not defined and -k not given")
+	}
+	if *baseURL == "" {
+		log.Fatal("REDMINE_BASE_URL not defined and -b not given")
+	}
+
+	if *verbose {
+		log.Printf("syncing redmine attachments to %s", *syncDir)
+	}
+	if err := os.MkdirAll(*syncDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	state, err := redminesync.OpenStateStore(filepath.Join(*syncDir, "state.db"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer state.Close()
+
+	syncer := redminesync.NewSyncer(*baseURL, *apiKey, *syncDir, *concurrency)
+	syncer.Verbose = *verbose
+	syncer.State = state
+
+	if *include != "" {
+		var kinds []redminesync.ResourceKind
+		for _, k := range strings.Split(*include, ",") {
+			kinds = append(kinds, redminesync.ResourceKind(strings.TrimSpace(k)))
+		}
+		exporter := redminesync.NewExporter(*baseURL, *apiKey, *syncDir, kinds)
+		syncer.Exporter = exporter
+		if err := exporter.ExportAll(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fullScan := *full || *startIssueNumber != 0 || *endIssueNumber != 0
+
+	var bar *progressbar.ProgressBar
+	var onProgress func()
+	newOnProgress := func(total int) {
+		if *showProgress && !*verbose && total > 0 {
+			bar = progressbar.New(total)
+			var barMu sync.Mutex
+			onProgress = func() {
+				barMu.Lock()
+				bar.Add(1)
+				barMu.Unlock()
+			}
+		}
+	}
+
+	if fullScan {
+		if *startIssueNumber == 0 {
+			*startIssueNumber = 1
+		}
+		if *endIssueNumber == 0 {
+			maxIssue, err := redminesync.FindMaxIssue(*baseURL, *apiKey)
+			if err != nil {
+				log.Fatal(err)
+			}
+			*endIssueNumber = maxIssue
+			if *verbose {
+				log.Printf("found max issue number: %d", maxIssue)
+			}
+		}
+		newOnProgress(*endIssueNumber - *startIssueNumber)
+		if err := syncer.Sync(*startIssueNumber, *endIssueNumber, onProgress); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		watermark := *since
+		if watermark == "" {
+			watermark, err = state.LastSync()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *verbose {
+			if watermark == "" {
+				log.Printf("no saved state, fetching all issues (use -full to always force this)")
+			} else {
+				log.Printf("fetching issues updated since %s", watermark)
+			}
+		}
+		ids, err := redminesync.ListChangedIssues(*baseURL, *apiKey, watermark)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *verbose {
+			log.Printf("%d issue(s) changed", len(ids))
+		}
+		newOnProgress(len(ids))
+		if err := syncer.SyncIssues(ids, onProgress); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Advance the watermark to the newest updated_on actually seen, whether
+	// this was a full scan or an incremental run, so the next incremental
+	// run picks up where this one left off. If nothing was seen (e.g. an
+	// empty range, or every issue 404/403'd), leave the saved watermark
+	// alone rather than resetting it.
+	if newWatermark := syncer.MaxUpdatedOn(); newWatermark != "" {
+		if err := state.SetLastSync(newWatermark); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/miku/redminesync/client"
+	log "github.com/sirupsen/logrus"
+)
+
+// runUpload uploads a local file and attaches it to an existing issue via
+// the two-step Redmine upload API.
+func runUpload(args []string) {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	apiKey := fs.String("k", os.Getenv("REDMINE_API_KEY"), "redmine API key possible from envvar REDMINE_API_KEY")
+	baseURL := fs.String("b", os.Getenv("REDMINE_BASE_URL"), "base URL")
+	issue := fs.Int64("issue", 0, "issue id to attach the uploaded file to")
+	note := fs.String("note", "", "optional note to add alongside the attachment")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "redminesync upload [-k apikey] [-b URL] -issue N [-note TEXT] <file>\n\nUploads a file and attaches it to an existing issue.\n")
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *issue == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *apiKey == "" {
+		log.Fatal("REDMINE_API_KEY not defined and -k not given")
+	}
+	if *baseURL == "" {
+		log.Fatal("REDMINE_BASE_URL not defined and -b not given")
+	}
+
+	c := client.New(*baseURL, *apiKey)
+	upload, err := c.UploadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.UpdateIssue(*issue, client.IssueFields{
+		Notes:   *note,
+		Uploads: []client.Upload{upload},
+	}); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("attached %s to issue %d", fs.Arg(0), *issue)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+	"github.com/miku/redminesync"
+	log "github.com/sirupsen/logrus"
+)
+
+// runVerify walks the object store, re-hashing every object and reporting
+// any whose content no longer matches its digest (bit-rot).
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	syncDir := fs.String("d", filepath.Join(xdg.CacheHome, ".redminesync"), "sync directory")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "redminesync verify [-d DIRECTORY]\n\nRe-hashes every object in the store and reports any that have bit-rotted.\n")
+	}
+	fs.Parse(args)
+
+	store := redminesync.NewObjectStore(filepath.Join(*syncDir, "objects"))
+	bad, err := store.Verify()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(bad) == 0 {
+		log.Printf("ok: all objects verified")
+		return
+	}
+	for _, digest := range bad {
+		fmt.Println(digest)
+	}
+	log.Fatalf("%d object(s) failed verification", len(bad))
+}
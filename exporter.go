@@ -0,0 +1,351 @@
+package redminesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// exportPageSize is the number of items requested per page when paginating
+// index endpoints such as /projects.json and /users.json.
+const exportPageSize = 100
+
+// ResourceKind names a Redmine resource the Exporter knows how to archive.
+type ResourceKind string
+
+// Resource kinds selectable via Exporter.Kinds / -include.
+const (
+	ResourceIssues   ResourceKind = "issues"
+	ResourceWiki     ResourceKind = "wiki"
+	ResourceProjects ResourceKind = "projects"
+	ResourceVersions ResourceKind = "versions"
+	ResourceUsers    ResourceKind = "users"
+)
+
+// AllResourceKinds lists every resource kind the Exporter supports. The
+// order of this list does not set the export order: ExportAll exports
+// projects, versions, users and then wiki pages, and issues are archived as
+// the Syncer fetches them.
+var AllResourceKinds = []ResourceKind{
+	ResourceProjects,
+	ResourceVersions,
+	ResourceWiki,
+	ResourceUsers,
+	ResourceIssues,
+}
+
+// Exporter archives Redmine resources beyond plain attachments: full issue
+// payloads (journals, changesets, custom fields, relations, watchers),
+// project metadata, wiki pages and versions. Each resource kind is
+// independently selectable so callers can archive only what they need.
+type Exporter struct {
+	BaseURL string
+	APIKey  string
+	SyncDir string
+	Kinds   []ResourceKind
+
+	client *http.Client
+}
+
+// NewExporter creates an Exporter that archives the given resource kinds
+// under syncDir. An empty kinds list means AllResourceKinds.
+func NewExporter(baseURL, apiKey, syncDir string, kinds []ResourceKind) *Exporter {
+	if len(kinds) == 0 {
+		kinds = AllResourceKinds
+	}
+	return &Exporter{
+		BaseURL: baseURL,
+		APIKey:  apiKey,
+		SyncDir: syncDir,
+		Kinds:   kinds,
+		client:  http.DefaultClient,
+	}
+}
+
+// Wants reports whether the given resource kind was selected for this
+// Exporter.
+func (e *Exporter) Wants(kind ResourceKind) bool {
+	for _, k := range e.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchJSON GETs link and decodes the JSON body into out, using the shared
+// transfer-manager retry/backoff logic.
+func (e *Exporter) fetchJSON(link string, out interface{}) error {
+	body, err := getWithRetry(e.client, e.APIKey, link)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(out)
+}
+
+// writeJSON writes v as indented JSON to path, creating parent directories
+// as needed.
+func writeJSON(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// ExportIssue persists the full issue payload, including journals,
+// changesets, custom fields, relations and watchers, as
+// <SyncDir>/<id>/issue.json.
+func (e *Exporter) ExportIssue(issue IssueResponse) error {
+	path := filepath.Join(e.SyncDir, fmt.Sprintf("%d", issue.Issue.Id), "issue.json")
+	return writeJSON(path, issue)
+}
+
+// projectsResponse is the envelope returned by GET /projects.json.
+type projectsResponse struct {
+	Projects []struct {
+		Id         int64  `json:"id"`
+		Name       string `json:"name"`
+		Identifier string `json:"identifier"`
+	} `json:"projects"`
+	TotalCount int64 `json:"total_count"`
+	Offset     int64 `json:"offset"`
+	Limit      int64 `json:"limit"`
+}
+
+// ExportProjects fetches /projects.json, paginating through every project,
+// writes one file per project to <SyncDir>/projects/<id>/project.json, and
+// returns the project identifiers found, for use by ExportWiki.
+func (e *Exporter) ExportProjects() ([]string, error) {
+	var identifiers []string
+	for offset := 0; ; offset += exportPageSize {
+		link := fmt.Sprintf("%s/projects.json?offset=%d&limit=%d", e.BaseURL, offset, exportPageSize)
+		var resp projectsResponse
+		if err := e.fetchJSON(link, &resp); err != nil {
+			if err == errSkip {
+				return identifiers, nil
+			}
+			return nil, err
+		}
+		for _, p := range resp.Projects {
+			path := filepath.Join(e.SyncDir, "projects", fmt.Sprintf("%d", p.Id), "project.json")
+			if err := writeJSON(path, p); err != nil {
+				return nil, err
+			}
+			identifiers = append(identifiers, p.Identifier)
+		}
+		if len(resp.Projects) < exportPageSize || int64(offset+exportPageSize) >= resp.TotalCount {
+			break
+		}
+	}
+	return identifiers, nil
+}
+
+// exportedUser is the subset of a Redmine user persisted by ExportUsers.
+type exportedUser struct {
+	Id        int64  `json:"id"`
+	Login     string `json:"login"`
+	Firstname string `json:"firstname"`
+	Lastname  string `json:"lastname"`
+}
+
+// usersResponse is the envelope returned by GET /users.json.
+type usersResponse struct {
+	Users      []exportedUser `json:"users"`
+	TotalCount int64          `json:"total_count"`
+	Offset     int64          `json:"offset"`
+	Limit      int64          `json:"limit"`
+}
+
+// ExportUsers fetches /users.json, paginating through every user, and
+// writes the combined list to <SyncDir>/users.json. A 403 (non-admin API
+// key, which /users.json requires) is treated as nothing to export rather
+// than a hard failure.
+func (e *Exporter) ExportUsers() error {
+	var users []exportedUser
+	for offset := 0; ; offset += exportPageSize {
+		link := fmt.Sprintf("%s/users.json?offset=%d&limit=%d", e.BaseURL, offset, exportPageSize)
+		var resp usersResponse
+		if err := e.fetchJSON(link, &resp); err != nil {
+			if err == errSkip {
+				return nil
+			}
+			return err
+		}
+		users = append(users, resp.Users...)
+		if len(resp.Users) < exportPageSize || int64(offset+exportPageSize) >= resp.TotalCount {
+			break
+		}
+	}
+	return writeJSON(filepath.Join(e.SyncDir, "users.json"), users)
+}
+
+// wikiIndexResponse is the envelope returned by GET
+// /projects/<id>/wiki/index.json.
+type wikiIndexResponse struct {
+	WikiPages []struct {
+		Title     string `json:"title"`
+		Version   int64  `json:"version"`
+		CreatedOn string `json:"created_on"`
+		UpdatedOn string `json:"updated_on"`
+	} `json:"wiki_pages"`
+}
+
+// wikiPageResponse is the envelope returned by GET
+// /projects/<id>/wiki/<title>.json, including attachments when requested.
+type wikiPageResponse struct {
+	WikiPage struct {
+		Title       string `json:"title"`
+		Text        string `json:"text"`
+		Version     int64  `json:"version"`
+		Attachments []struct {
+			ContentUrl string `json:"content_url"`
+			Filename   string `json:"filename"`
+			Id         int64  `json:"id"`
+		} `json:"attachments"`
+	} `json:"wiki_page"`
+}
+
+// ExportWiki archives every wiki page (and its attachments) for the given
+// project identifier under <SyncDir>/projects/<projectIdentifier>/wiki/.
+func (e *Exporter) ExportWiki(projectIdentifier string) error {
+	indexLink := fmt.Sprintf("%s/projects/%s/wiki/index.json", e.BaseURL, projectIdentifier)
+	var index wikiIndexResponse
+	if err := e.fetchJSON(indexLink, &index); err != nil {
+		if err == errSkip {
+			return nil
+		}
+		return err
+	}
+	for _, page := range index.WikiPages {
+		pageLink := fmt.Sprintf("%s/projects/%s/wiki/%s.json?include=attachments", e.BaseURL, projectIdentifier, url.PathEscape(page.Title))
+		var full wikiPageResponse
+		if err := e.fetchJSON(pageLink, &full); err != nil {
+			if err == errSkip {
+				continue
+			}
+			return err
+		}
+		dir := filepath.Join(e.SyncDir, "projects", projectIdentifier, "wiki", sanitizePathComponent(page.Title))
+		if err := writeJSON(filepath.Join(dir, "page.json"), full); err != nil {
+			return err
+		}
+		for _, attachment := range full.WikiPage.Attachments {
+			dst := filepath.Join(dir, "attachments", attachment.Filename)
+			if _, err := os.Stat(dst); err == nil {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			body, err := getWithRetry(e.client, e.APIKey, attachment.ContentUrl)
+			if err != nil {
+				if err == errSkip {
+					continue
+				}
+				return err
+			}
+			err = writeStream(dst, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// versionsResponse is the envelope returned by GET /versions.json.
+type versionsResponse struct {
+	Versions []struct {
+		Id      int64  `json:"id"`
+		Name    string `json:"name"`
+		Status  string `json:"status"`
+		DueDate string `json:"due_date"`
+	} `json:"versions"`
+}
+
+// ExportVersions fetches /versions.json and writes it to
+// <SyncDir>/versions.json. A 404/403 (not every Redmine instance exposes a
+// global versions endpoint) is treated as nothing to export.
+func (e *Exporter) ExportVersions() error {
+	link := fmt.Sprintf("%s/versions.json", e.BaseURL)
+	var resp versionsResponse
+	if err := e.fetchJSON(link, &resp); err != nil {
+		if err == errSkip {
+			return nil
+		}
+		return err
+	}
+	return writeJSON(filepath.Join(e.SyncDir, "versions.json"), resp.Versions)
+}
+
+// sanitizePathComponent makes a Redmine wiki page title safe to use as a
+// single filesystem path component, replacing path separators (which would
+// otherwise let a crafted title escape the wiki export directory) with
+// underscores.
+func sanitizePathComponent(name string) string {
+	name = strings.ReplaceAll(name, "/", "_")
+	name = strings.ReplaceAll(name, `\`, "_")
+	return name
+}
+
+// ExportAll archives every resource kind the Exporter was configured with,
+// except issues, which are archived incrementally as the Syncer fetches
+// them (see Syncer.Exporter).
+func (e *Exporter) ExportAll() error {
+	var identifiers []string
+	if e.Wants(ResourceProjects) || e.Wants(ResourceWiki) {
+		ids, err := e.ExportProjects()
+		if err != nil {
+			return err
+		}
+		identifiers = ids
+	}
+	if e.Wants(ResourceVersions) {
+		if err := e.ExportVersions(); err != nil {
+			return err
+		}
+	}
+	if e.Wants(ResourceUsers) {
+		if err := e.ExportUsers(); err != nil {
+			return err
+		}
+	}
+	if e.Wants(ResourceWiki) {
+		for _, identifier := range identifiers {
+			if err := e.ExportWiki(identifier); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeStream copies r to a temp file and atomically renames it to dst,
+// so a crash mid-download never leaves a truncated file in place.
+func writeStream(dst string, r io.Reader) error {
+	tf, err := ioutil.TempFile("", "redminesync-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tf, r); err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), dst)
+}
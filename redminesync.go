@@ -0,0 +1,127 @@
+// Package redminesync implements a small client and sync engine for
+// mirroring data out of a Redmine instance (http://www.redmine.org) via its
+// REST API.
+package redminesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// IssueResponse represents an issue, including various optional items, such
+// as children, attachments, relations, changesets, journals and watchers
+// (http://www.redmine.org/projects/redmine/wiki/Rest_Issues#Showing-an-issue).
+type IssueResponse struct {
+	Issue struct {
+		AssignedTo struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"assigned_to"`
+		Attachments []struct {
+			Author struct {
+				Id   int64  `json:"id"`
+				Name string `json:"name"`
+			} `json:"author"`
+			ContentType string `json:"content_type"`
+			ContentUrl  string `json:"content_url"`
+			CreatedOn   string `json:"created_on"`
+			Description string `json:"description"`
+			Filename    string `json:"filename"`
+			Filesize    int64  `json:"filesize"`
+			Id          int64  `json:"id"`
+		} `json:"attachments"`
+		Author struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"author"`
+		Changesets []struct {
+			Comments    string `json:"comments"`
+			CommittedOn string `json:"committed_on"`
+			Revision    string `json:"revision"`
+			User        struct {
+				Id   int64  `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"changesets"`
+		CreatedOn    string `json:"created_on"`
+		CustomFields []struct {
+			Id    int64  `json:"id"`
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"custom_fields"`
+		Description  string `json:"description"`
+		DoneRatio    int64  `json:"done_ratio"`
+		FixedVersion struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"fixed_version"`
+		Id       int64 `json:"id"`
+		Journals []struct {
+			CreatedOn string        `json:"created_on"`
+			Details   []interface{} `json:"details"`
+			Id        int64         `json:"id"`
+			Notes     string        `json:"notes"`
+			User      struct {
+				Id   int64  `json:"id"`
+				Name string `json:"name"`
+			} `json:"user"`
+		} `json:"journals"`
+		Priority struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"priority"`
+		Project struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"project"`
+		StartDate string `json:"start_date"`
+		Status    struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"status"`
+		Subject string `json:"subject"`
+		Tracker struct {
+			Id   int64  `json:"id"`
+			Name string `json:"name"`
+		} `json:"tracker"`
+		UpdatedOn string `json:"updated_on"`
+	} `json:"issue"`
+}
+
+// issueIndexResponse is the envelope returned by the issues index endpoint,
+// e.g. GET /issues.json.
+type issueIndexResponse struct {
+	Issues []struct {
+		Id int64 `json:"id"`
+	} `json:"issues"`
+	TotalCount int64 `json:"total_count"`
+}
+
+// FindMaxIssue returns the highest known issue id on the given Redmine
+// instance, by asking for a single issue sorted by id descending.
+func FindMaxIssue(baseURL, apiKey string) (int, error) {
+	link := fmt.Sprintf("%s/issues.json?status_id=*&sort=id:desc&limit=1", baseURL)
+	req, err := http.NewRequest("GET", link, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Add("X-Redmine-API-Key", apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return 0, fmt.Errorf("bad status: %s", resp.Status)
+	}
+	var result issueIndexResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	if len(result.Issues) == 0 {
+		return 0, fmt.Errorf("no issues found")
+	}
+	return int(result.Issues[0].Id), nil
+}
@@ -0,0 +1,185 @@
+package redminesync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var issuesBucket = []byte("issues")
+var metaBucket = []byte("meta")
+
+// lastSyncKey stores the updated_on timestamp of the most recently seen
+// issue across all previous syncs, so the next incremental run knows where
+// to resume from.
+var lastSyncKey = []byte("last_sync")
+
+// IssueState is the persisted state for a single issue: the updated_on
+// timestamp last seen on the server, and the attachment ids already
+// downloaded for it.
+type IssueState struct {
+	UpdatedOn     string  `json:"updated_on"`
+	AttachmentIDs []int64 `json:"attachment_ids"`
+}
+
+// StateStore is a small BoltDB-backed database that records, per issue, the
+// last seen updated_on timestamp and the set of attachment ids already
+// downloaded. It lets a Syncer skip attachments it has already mirrored, and
+// keeps the updated_on watermark an incremental run uses to list only
+// changed issues.
+type StateStore struct {
+	db *bolt.DB
+}
+
+// OpenStateStore opens (creating if necessary) the state database at path.
+func OpenStateStore(path string) (*StateStore, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(issuesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &StateStore{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *StateStore) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the stored state for an issue, and whether it was found.
+func (s *StateStore) Get(issueID int) (IssueState, bool, error) {
+	var state IssueState
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(issuesBucket).Get(issueKey(issueID))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &state)
+	})
+	return state, found, err
+}
+
+// Put persists the state for an issue.
+func (s *StateStore) Put(issueID int, state IssueState) error {
+	v, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(issuesBucket).Put(issueKey(issueID), v)
+	})
+}
+
+// HasAttachment reports whether an attachment id has already been recorded
+// as downloaded for the given issue.
+func (s *StateStore) HasAttachment(issueID int, attachmentID int64) (bool, error) {
+	state, found, err := s.Get(issueID)
+	if err != nil || !found {
+		return false, err
+	}
+	for _, id := range state.AttachmentIDs {
+		if id == attachmentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LastSync returns the updated_on timestamp watermark from the most recent
+// successful sync, or the zero value if none has run yet.
+func (s *StateStore) LastSync() (string, error) {
+	var since string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBucket).Get(lastSyncKey)
+		since = string(v)
+		return nil
+	})
+	return since, err
+}
+
+// SetLastSync records the updated_on timestamp watermark for the next
+// incremental run.
+func (s *StateStore) SetLastSync(since string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(lastSyncKey, []byte(since))
+	})
+}
+
+func issueKey(issueID int) []byte {
+	return []byte(fmt.Sprintf("%d", issueID))
+}
+
+// changedIssuesResponse is the envelope returned by the issues index
+// endpoint when filtering and sorting by updated_on.
+type changedIssuesResponse struct {
+	Issues []struct {
+		Id        int64  `json:"id"`
+		UpdatedOn string `json:"updated_on"`
+	} `json:"issues"`
+	TotalCount int64 `json:"total_count"`
+	Offset     int64 `json:"offset"`
+	Limit      int64 `json:"limit"`
+}
+
+// pageSize is the number of issues requested per page when enumerating
+// changed issues.
+const pageSize = 100
+
+// ListChangedIssues returns the ids of issues updated at or after since
+// (RFC3339), newest first, across all statuses. An empty since lists every
+// issue, which is equivalent to a full scan.
+func ListChangedIssues(baseURL, apiKey, since string) ([]int, error) {
+	var ids []int
+	for offset := 0; ; offset += pageSize {
+		q := url.Values{}
+		q.Set("status_id", "*")
+		q.Set("sort", "updated_on:desc")
+		q.Set("limit", fmt.Sprintf("%d", pageSize))
+		q.Set("offset", fmt.Sprintf("%d", offset))
+		if since != "" {
+			q.Set("updated_on", ">="+since)
+		}
+		link := fmt.Sprintf("%s/issues.json?%s", baseURL, q.Encode())
+		req, err := http.NewRequest("GET", link, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("X-Redmine-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page changedIssuesResponse
+		decErr := json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("bad status: %s", resp.Status)
+		}
+		if decErr != nil {
+			return nil, decErr
+		}
+		for _, issue := range page.Issues {
+			ids = append(ids, int(issue.Id))
+		}
+		if len(page.Issues) < pageSize || int64(offset+pageSize) >= page.TotalCount {
+			break
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,88 @@
+package redminesync
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func openTestStateStore(t *testing.T) *StateStore {
+	t.Helper()
+	store, err := OpenStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatalf("OpenStateStore: %s", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestStateStorePutGet(t *testing.T) {
+	store := openTestStateStore(t)
+
+	if _, found, err := store.Get(42); err != nil {
+		t.Fatalf("Get on empty store: %s", err)
+	} else if found {
+		t.Fatalf("Get on empty store reported found=true")
+	}
+
+	want := IssueState{UpdatedOn: "2024-01-02T03:04:05Z", AttachmentIDs: []int64{1, 2, 3}}
+	if err := store.Put(42, want); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	got, found, err := store.Get(42)
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if !found {
+		t.Fatalf("Get after Put reported found=false")
+	}
+	if got.UpdatedOn != want.UpdatedOn || len(got.AttachmentIDs) != len(want.AttachmentIDs) {
+		t.Fatalf("Get after Put = %+v, want %+v", got, want)
+	}
+}
+
+func TestStateStoreHasAttachment(t *testing.T) {
+	store := openTestStateStore(t)
+
+	if has, err := store.HasAttachment(7, 99); err != nil {
+		t.Fatalf("HasAttachment on empty store: %s", err)
+	} else if has {
+		t.Fatalf("HasAttachment on empty store reported true")
+	}
+
+	if err := store.Put(7, IssueState{AttachmentIDs: []int64{99, 100}}); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	if has, err := store.HasAttachment(7, 99); err != nil {
+		t.Fatalf("HasAttachment: %s", err)
+	} else if !has {
+		t.Fatalf("HasAttachment(7, 99) = false, want true")
+	}
+	if has, err := store.HasAttachment(7, 101); err != nil {
+		t.Fatalf("HasAttachment: %s", err)
+	} else if has {
+		t.Fatalf("HasAttachment(7, 101) = true, want false")
+	}
+}
+
+func TestStateStoreLastSync(t *testing.T) {
+	store := openTestStateStore(t)
+
+	if since, err := store.LastSync(); err != nil {
+		t.Fatalf("LastSync on empty store: %s", err)
+	} else if since != "" {
+		t.Fatalf("LastSync on empty store = %q, want empty", since)
+	}
+
+	if err := store.SetLastSync("2024-06-01T00:00:00Z"); err != nil {
+		t.Fatalf("SetLastSync: %s", err)
+	}
+	since, err := store.LastSync()
+	if err != nil {
+		t.Fatalf("LastSync: %s", err)
+	}
+	if since != "2024-06-01T00:00:00Z" {
+		t.Fatalf("LastSync = %q, want %q", since, "2024-06-01T00:00:00Z")
+	}
+}
@@ -0,0 +1,229 @@
+package redminesync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ObjectStore is a content-addressable store for attachment bodies, keyed
+// by their sha256 digest: <Root>/sha256/ab/cdef... Per-issue paths hold
+// symlinks into the store, so the same attachment shared across many
+// issues is only ever stored once.
+type ObjectStore struct {
+	Root string
+}
+
+// NewObjectStore creates an ObjectStore rooted at the given directory,
+// typically <syncDir>/objects.
+func NewObjectStore(root string) *ObjectStore {
+	return &ObjectStore{Root: root}
+}
+
+// objectPath returns the path an object with the given hex sha256 digest is
+// stored at.
+func (o *ObjectStore) objectPath(digest string) string {
+	return filepath.Join(o.Root, "sha256", digest[:2], digest[2:])
+}
+
+// DigestAt resolves the object a symlink created by Link points at and
+// returns its digest, reconstructed from the shard/file path components.
+func (o *ObjectStore) DigestAt(linkPath string) (string, error) {
+	target, err := os.Readlink(linkPath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(linkPath), target)
+	}
+	return filepath.Base(filepath.Dir(target)) + filepath.Base(target), nil
+}
+
+// Has reports whether an object with the given digest already exists.
+func (o *ObjectStore) Has(digest string) bool {
+	_, err := os.Stat(o.objectPath(digest))
+	return err == nil
+}
+
+// Put moves src (expected to be a temp file holding content already hashed
+// to digest) into the store, deduplicating against an existing object with
+// the same digest.
+func (o *ObjectStore) Put(src, digest string) (string, error) {
+	dst := o.objectPath(digest)
+	if o.Has(digest) {
+		os.Remove(src)
+		return dst, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// Link creates or replaces a symlink at linkPath pointing at the object for
+// digest, relative to linkPath's directory.
+func (o *ObjectStore) Link(linkPath, digest string) error {
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return err
+	}
+	target := o.objectPath(digest)
+	rel, err := filepath.Rel(filepath.Dir(linkPath), target)
+	if err != nil {
+		rel = target
+	}
+	if _, err := os.Lstat(linkPath); err == nil {
+		if err := os.Remove(linkPath); err != nil {
+			return err
+		}
+	}
+	return os.Symlink(rel, linkPath)
+}
+
+// StoreStream copies r into a temp file while hashing it, checks the result
+// against expectedSize (skipped if expectedSize <= 0), and only then moves
+// it into the store. If the size doesn't match, the temp file is discarded
+// and an *ErrSizeMismatch is returned without ever touching the store, so a
+// truncated or corrupt transfer never gets committed as content-addressed
+// content.
+func (o *ObjectStore) StoreStream(r io.Reader, expectedSize int64) (digest string, size int64, err error) {
+	tf, err := ioutil.TempFile("", "redminesync-obj-")
+	if err != nil {
+		return "", 0, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(tf, io.TeeReader(r, h))
+	if err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return "", 0, err
+	}
+	if err := tf.Close(); err != nil {
+		os.Remove(tf.Name())
+		return "", 0, err
+	}
+	if expectedSize > 0 && n != expectedSize {
+		os.Remove(tf.Name())
+		return "", 0, &ErrSizeMismatch{Got: n, Expected: expectedSize}
+	}
+	digest = hex.EncodeToString(h.Sum(nil))
+	if _, err := o.Put(tf.Name(), digest); err != nil {
+		return "", 0, err
+	}
+	return digest, n, nil
+}
+
+// Verify walks every object in the store, rehashes it, and returns the
+// digests of any objects whose content no longer matches their path
+// (bit-rot). A filesystem error stops the walk and is returned together
+// with the digests found bad up to that point.
+func (o *ObjectStore) Verify() ([]string, error) {
+	root := filepath.Join(o.Root, "sha256")
+	var bad []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		want := strings.ReplaceAll(rel, string(filepath.Separator), "")
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			bad = append(bad, want)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return bad, nil
+	}
+	return bad, err
+}
+
+// GC removes store objects that are no longer referenced by any symlink
+// under syncDir, and returns the paths it removed.
+func (o *ObjectStore) GC(syncDir string) ([]string, error) {
+	referenced := make(map[string]bool)
+	err := filepath.Walk(syncDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			return nil
+		}
+		referenced[abs] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	root := filepath.Join(o.Root, "sha256")
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if !referenced[abs] {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed = append(removed, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	return removed, err
+}
+
+// ErrSizeMismatch is returned by callers that compare a downloaded object's
+// size against an expected Filesize from Redmine metadata.
+type ErrSizeMismatch struct {
+	Link     string
+	Got      int64
+	Expected int64
+}
+
+func (e *ErrSizeMismatch) Error() string {
+	return fmt.Sprintf("size mismatch for %s: got %d, expected %d", e.Link, e.Got, e.Expected)
+}
@@ -0,0 +1,123 @@
+package redminesync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestObjectStoreStoreStreamAndLink(t *testing.T) {
+	root := t.TempDir()
+	store := NewObjectStore(filepath.Join(root, "objects"))
+
+	digest, n, err := store.StoreStream(strings.NewReader("hello world"), 11)
+	if err != nil {
+		t.Fatalf("StoreStream: %s", err)
+	}
+	if n != 11 {
+		t.Fatalf("StoreStream returned size %d, want 11", n)
+	}
+	if !store.Has(digest) {
+		t.Fatalf("object %s not present in store after StoreStream", digest)
+	}
+
+	linkPath := filepath.Join(root, "1", "2", "hello.txt")
+	if err := store.Link(linkPath, digest); err != nil {
+		t.Fatalf("Link: %s", err)
+	}
+	b, err := os.ReadFile(linkPath)
+	if err != nil {
+		t.Fatalf("reading through symlink: %s", err)
+	}
+	if string(b) != "hello world" {
+		t.Fatalf("content through symlink = %q, want %q", b, "hello world")
+	}
+}
+
+func TestObjectStoreStoreStreamDedup(t *testing.T) {
+	root := t.TempDir()
+	store := NewObjectStore(filepath.Join(root, "objects"))
+
+	d1, _, err := store.StoreStream(strings.NewReader("same content"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream 1: %s", err)
+	}
+	d2, _, err := store.StoreStream(strings.NewReader("same content"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream 2: %s", err)
+	}
+	if d1 != d2 {
+		t.Fatalf("identical content got different digests: %s != %s", d1, d2)
+	}
+}
+
+func TestObjectStoreStoreStreamSizeMismatch(t *testing.T) {
+	root := t.TempDir()
+	store := NewObjectStore(filepath.Join(root, "objects"))
+
+	_, _, err := store.StoreStream(strings.NewReader("short"), 999)
+	if _, ok := err.(*ErrSizeMismatch); !ok {
+		t.Fatalf("expected *ErrSizeMismatch, got %T: %v", err, err)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(store.Root, "sha256"))
+	if err == nil && len(entries) != 0 {
+		t.Fatalf("object was committed to the store despite a size mismatch: %v", entries)
+	}
+}
+
+func TestObjectStoreVerifyDetectsBitRot(t *testing.T) {
+	root := t.TempDir()
+	store := NewObjectStore(filepath.Join(root, "objects"))
+
+	digest, _, err := store.StoreStream(strings.NewReader("pristine content"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream: %s", err)
+	}
+	if bad, err := store.Verify(); err != nil || len(bad) != 0 {
+		t.Fatalf("Verify on pristine store = (%v, %v), want (nil, nil)", bad, err)
+	}
+
+	if err := os.WriteFile(store.objectPath(digest), []byte("corrupted"), 0644); err != nil {
+		t.Fatalf("corrupting object: %s", err)
+	}
+	bad, err := store.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	if len(bad) != 1 || bad[0] != digest {
+		t.Fatalf("Verify after corruption = %v, want [%s]", bad, digest)
+	}
+}
+
+func TestObjectStoreGC(t *testing.T) {
+	syncDir := t.TempDir()
+	store := NewObjectStore(filepath.Join(syncDir, "objects"))
+
+	keepDigest, _, err := store.StoreStream(strings.NewReader("keep me"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream keep: %s", err)
+	}
+	dropDigest, _, err := store.StoreStream(strings.NewReader("drop me"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream drop: %s", err)
+	}
+	if err := store.Link(filepath.Join(syncDir, "1", "attachments", "keep.txt"), keepDigest); err != nil {
+		t.Fatalf("Link: %s", err)
+	}
+
+	removed, err := store.GC(syncDir)
+	if err != nil {
+		t.Fatalf("GC: %s", err)
+	}
+	if len(removed) != 1 {
+		t.Fatalf("GC removed %d objects, want 1", len(removed))
+	}
+	if !store.Has(keepDigest) {
+		t.Fatalf("GC removed referenced object %s", keepDigest)
+	}
+	if store.Has(dropDigest) {
+		t.Fatalf("GC left unreferenced object %s in place", dropDigest)
+	}
+}
@@ -0,0 +1,411 @@
+package redminesync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Default retry/backoff parameters used by the Syncer's transfer manager.
+const (
+	defaultMaxRetries  = 5
+	defaultBaseBackoff = 500 * time.Millisecond
+	defaultMaxBackoff  = 30 * time.Second
+)
+
+// Syncer mirrors issues and attachments from a Redmine instance into a
+// local directory. It runs fetches and downloads through a bounded worker
+// pool, retries transient failures with exponential backoff, and
+// deduplicates in-flight attachment downloads by content URL so concurrent
+// requests for the same attachment share a single fetch.
+type Syncer struct {
+	BaseURL     string
+	APIKey      string
+	SyncDir     string
+	Concurrency int
+	Verbose     bool
+
+	// State, if set, is consulted to skip attachments already downloaded in
+	// a previous run, and updated with each issue's updated_on and
+	// attachment ids as it is fetched. Every issue handed to the Syncer is
+	// still fetched; State is not used to skip issues.
+	State *StateStore
+
+	// Exporter, if set and configured with ResourceIssues, receives the
+	// full issue payload for archiving alongside attachment mirroring.
+	Exporter *Exporter
+
+	// Store is the content-addressable object store attachments are
+	// downloaded into. It is created under SyncDir/objects by NewSyncer.
+	Store *ObjectStore
+
+	client *http.Client
+
+	mu           sync.Mutex
+	inflight     map[string]*inflightDownload
+	maxUpdatedOn string
+}
+
+// inflightDownload tracks a download in progress for a given content URL, so
+// that other issues sharing the same attachment can wait for it to finish
+// and then link their own conventional path to the result, rather than
+// fetching the content twice.
+type inflightDownload struct {
+	wg     sync.WaitGroup
+	digest string
+	err    error
+}
+
+// NewSyncer creates a Syncer. Concurrency is clamped to at least 1.
+func NewSyncer(baseURL, apiKey, syncDir string, concurrency int) *Syncer {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Syncer{
+		BaseURL:     baseURL,
+		APIKey:      apiKey,
+		SyncDir:     syncDir,
+		Concurrency: concurrency,
+		Store:       NewObjectStore(filepath.Join(syncDir, "objects")),
+		client:      http.DefaultClient,
+		inflight:    make(map[string]*inflightDownload),
+	}
+}
+
+// issueJob is a single unit of work processed by the worker pool.
+type issueJob struct {
+	id int
+}
+
+// Sync walks issue ids from start to end (inclusive), downloading each
+// issue's attachments through the worker pool. It returns the first error
+// encountered by any worker, after every issue in the range has been
+// processed.
+func (s *Syncer) Sync(start, end int, onProgress func()) error {
+	ids := make([]int, 0, end-start+1)
+	for i := start; i <= end; i++ {
+		ids = append(ids, i)
+	}
+	return s.SyncIssues(ids, onProgress)
+}
+
+// SyncIssues downloads attachments for exactly the given issue ids, through
+// the worker pool and retry machinery. It is used both for a full scan
+// (Sync) and for incremental runs where the set of changed issues is
+// already known.
+//
+// Errors are collected without blocking any worker: a worker that hits an
+// error records it (keeping only the first) and keeps draining jobs, so one
+// bad issue can never wedge the pool or the feeder goroutine.
+func (s *Syncer) SyncIssues(ids []int, onProgress func()) error {
+	jobs := make(chan issueJob)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for w := 0; w < s.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if onProgress != nil {
+					onProgress()
+				}
+				if err := s.syncIssue(job.id); err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("issue %d: %w", job.id, err)
+					})
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, id := range ids {
+			jobs <- issueJob{id: id}
+		}
+		close(jobs)
+	}()
+
+	wg.Wait()
+	return firstErr
+}
+
+// syncIssue fetches a single issue (with attachments), downloads any
+// attachments not already present locally, and records its state if a
+// StateStore is configured.
+func (s *Syncer) syncIssue(id int) error {
+	link := fmt.Sprintf("%s/issues/%d.json?include=attachments", s.BaseURL, id)
+	body, err := s.getWithRetry(link)
+	if err != nil {
+		if err == errSkip {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+
+	var issue IssueResponse
+	if err := json.NewDecoder(body).Decode(&issue); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	s.observeUpdatedOn(issue.Issue.UpdatedOn)
+
+	if s.Exporter != nil && s.Exporter.Wants(ResourceIssues) {
+		if err := s.Exporter.ExportIssue(issue); err != nil {
+			return err
+		}
+	}
+
+	state := IssueState{UpdatedOn: issue.Issue.UpdatedOn}
+	for _, attachment := range issue.Issue.Attachments {
+		if s.State != nil {
+			has, err := s.State.HasAttachment(id, attachment.Id)
+			if err != nil {
+				return err
+			}
+			if has {
+				state.AttachmentIDs = append(state.AttachmentIDs, attachment.Id)
+				continue
+			}
+		}
+		if err := s.downloadAttachment(attachment.ContentUrl, id, attachment.Filesize); err != nil {
+			if err == errIncomplete {
+				// Not recorded: leaving it out of state.AttachmentIDs means
+				// the next sync's HasAttachment check sees it as missing and
+				// retries the download, rather than treating a truncated
+				// transfer as done forever.
+				continue
+			}
+			return err
+		}
+		state.AttachmentIDs = append(state.AttachmentIDs, attachment.Id)
+	}
+	if s.State != nil {
+		if err := s.State.Put(id, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeUpdatedOn records updatedOn as the new high-water mark if it sorts
+// after whatever has been seen so far in this run. RFC3339 timestamps
+// compare correctly as plain strings.
+func (s *Syncer) observeUpdatedOn(updatedOn string) {
+	if updatedOn == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if updatedOn > s.maxUpdatedOn {
+		s.maxUpdatedOn = updatedOn
+	}
+}
+
+// MaxUpdatedOn returns the newest issue updated_on timestamp observed so far
+// in this run, or the empty string if none has been seen yet. Callers use
+// it as the watermark for the next incremental sync.
+func (s *Syncer) MaxUpdatedOn() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxUpdatedOn
+}
+
+// errSkip signals a 404/403 response, which callers treat as "nothing to
+// do here" rather than a hard failure.
+var errSkip = fmt.Errorf("skip")
+
+// errIncomplete signals that an attachment download was abandoned after a
+// size mismatch. syncIssue treats this as "not downloaded" rather than a
+// hard failure, so the attachment is retried on the next sync instead of
+// being recorded as done.
+var errIncomplete = fmt.Errorf("incomplete download")
+
+// getWithRetry performs a GET request, retrying on 5xx responses, 429 (honoring
+// Retry-After) and transient network errors, with exponential backoff and
+// jitter, for up to defaultMaxRetries retries after the first attempt.
+func (s *Syncer) getWithRetry(link string) (io.ReadCloser, error) {
+	return getWithRetry(s.client, s.APIKey, link)
+}
+
+// getWithRetry is the shared transfer-manager GET used by both the Syncer
+// and the Exporter: it retries on 5xx responses, 429 (honoring Retry-After)
+// and transient network errors, with exponential backoff and jitter, for up
+// to defaultMaxRetries retries after the first attempt.
+func getWithRetry(client *http.Client, apiKey, link string) (io.ReadCloser, error) {
+	var lastErr error
+	for attempt := 0; attempt <= defaultMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoffDuration(attempt, lastErr))
+		}
+		req, err := http.NewRequest("GET", link, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("X-Redmine-API-Key", apiKey)
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return resp.Body, nil
+		case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusForbidden:
+			resp.Body.Close()
+			return nil, errSkip
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait := retryAfter(resp.Header.Get("Retry-After"))
+			resp.Body.Close()
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+			lastErr = fmt.Errorf("rate limited: %s", link)
+		case resp.StatusCode >= 500:
+			resp.Body.Close()
+			lastErr = fmt.Errorf("server error %s: %s", resp.Status, link)
+		default:
+			resp.Body.Close()
+			return nil, fmt.Errorf("bad status: %s", resp.Status)
+		}
+	}
+	return nil, fmt.Errorf("giving up after %d attempts: %w", defaultMaxRetries+1, lastErr)
+}
+
+// backoffDuration computes an exponential backoff delay with jitter for the
+// given attempt number (1-indexed).
+func backoffDuration(attempt int, cause error) time.Duration {
+	d := defaultBaseBackoff * time.Duration(1<<uint(attempt-1))
+	if d > defaultMaxBackoff {
+		d = defaultMaxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(d) / 2))
+	return d/2 + jitter
+}
+
+// retryAfter parses a Retry-After header, which may be a number of seconds
+// or an HTTP date. Unparseable or empty values return 0.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// downloadAttachment downloads a single attachment for the given issue into
+// the content-addressable object store, deduplicating both concurrent
+// requests for the same content URL and identical content already stored
+// under a different attachment. A symlink at the attachment's conventional
+// path (<SyncDir>/<issue>/<id>/<filename>) points at the stored object.
+func (s *Syncer) downloadAttachment(link string, issue int, filesize int64) error {
+	u, err := url.Parse(link)
+	if err != nil {
+		return err
+	}
+	path := strings.Replace(u.Path, "attachments/download", "", 1)
+	if len(u.Path)-len(path) != len("attachments/download") {
+		return fmt.Errorf("unexpected redmine download url: %s", link)
+	}
+	linkPath := filepath.Join(s.SyncDir, fmt.Sprintf("%d", issue), path)
+
+	s.mu.Lock()
+	if dl, ok := s.inflight[link]; ok {
+		s.mu.Unlock()
+		dl.wg.Wait()
+		if dl.err != nil {
+			if dl.err == errSkip {
+				// Match the winner's own handling of a 404/403: nothing to
+				// download, nothing to link.
+				return nil
+			}
+			return dl.err
+		}
+		// The winner already fetched and stored the content; this issue
+		// still needs its own symlink at its own conventional path.
+		return s.Store.Link(linkPath, dl.digest)
+	}
+	dl := &inflightDownload{}
+	dl.wg.Add(1)
+	s.inflight[link] = dl
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, link)
+		s.mu.Unlock()
+		dl.wg.Done()
+	}()
+
+	if _, err := os.Lstat(linkPath); err == nil {
+		if s.Verbose {
+			log.Printf("already downloaded: %s", linkPath)
+		}
+		// A waiter may still need this digest to link its own path; recover
+		// it from the existing symlink rather than leaving dl.digest empty,
+		// which would make Store.Link(waiterPath, "") panic.
+		digest, derr := s.Store.DigestAt(linkPath)
+		if derr != nil {
+			dl.err = derr
+			return derr
+		}
+		dl.digest = digest
+		return nil
+	}
+
+	body, err := s.getWithRetry(link)
+	if err != nil {
+		dl.err = err
+		if err == errSkip {
+			return nil
+		}
+		return err
+	}
+	defer body.Close()
+
+	digest, n, err := s.Store.StoreStream(body, filesize)
+	if err != nil {
+		var sizeErr *ErrSizeMismatch
+		if errors.As(err, &sizeErr) {
+			sizeErr.Link = link
+			// A corrupt/truncated transfer is never committed to the store
+			// (StoreStream discards the temp file before returning this
+			// error), so it's safe to just warn and retry on the next sync
+			// rather than aborting the whole run over one bad attachment.
+			// errIncomplete tells syncIssue not to record this attachment as
+			// downloaded, so it's actually retried next time.
+			log.Printf("warning: %s, will retry on next sync", sizeErr)
+			dl.err = errIncomplete
+			return errIncomplete
+		}
+		dl.err = err
+		return err
+	}
+	dl.digest = digest
+	if err := s.Store.Link(linkPath, digest); err != nil {
+		dl.err = err
+		return err
+	}
+	if s.Verbose {
+		log.Printf("downloaded [%d]: %s -> %s", n, link, digest)
+	}
+	return nil
+}
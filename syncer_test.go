@@ -0,0 +1,121 @@
+package redminesync
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffDuration(t *testing.T) {
+	for attempt := 1; attempt <= 8; attempt++ {
+		d := backoffDuration(attempt, nil)
+		if d <= 0 {
+			t.Fatalf("attempt %d: backoffDuration returned non-positive duration %v", attempt, d)
+		}
+		if d > defaultMaxBackoff {
+			t.Fatalf("attempt %d: backoffDuration %v exceeds defaultMaxBackoff %v", attempt, d, defaultMaxBackoff)
+		}
+	}
+}
+
+func TestBackoffDurationCapsAtMax(t *testing.T) {
+	// A large attempt number gives a raw delay far above defaultMaxBackoff;
+	// after the cap the result must still land within (0, defaultMaxBackoff].
+	d := backoffDuration(20, nil)
+	if d <= 0 || d > defaultMaxBackoff {
+		t.Fatalf("backoffDuration(20) = %v, want in (0, %v]", d, defaultMaxBackoff)
+	}
+}
+
+func TestRetryAfterEmpty(t *testing.T) {
+	if got := retryAfter(""); got != 0 {
+		t.Fatalf("retryAfter(\"\") = %v, want 0", got)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	got := retryAfter("5")
+	if got != 5*time.Second {
+		t.Fatalf("retryAfter(\"5\") = %v, want 5s", got)
+	}
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(10 * time.Second).UTC()
+	header := future.Format(http.TimeFormat)
+	got := retryAfter(header)
+	if got <= 0 || got > 11*time.Second {
+		t.Fatalf("retryAfter(%q) = %v, want roughly 10s", header, got)
+	}
+}
+
+func TestRetryAfterUnparseable(t *testing.T) {
+	if got := retryAfter("not-a-valid-value"); got != 0 {
+		t.Fatalf("retryAfter(garbage) = %v, want 0", got)
+	}
+}
+
+// newTestSyncer returns a Syncer whose Store is rooted under a fresh temp
+// dir, suitable for exercising downloadAttachment's waiter paths directly.
+func newTestSyncer(t *testing.T) *Syncer {
+	t.Helper()
+	s := NewSyncer("http://example.invalid", "key", t.TempDir(), 1)
+	return s
+}
+
+func TestDownloadAttachmentWaiterLinksOwnPath(t *testing.T) {
+	s := newTestSyncer(t)
+	const link = "http://example.invalid/attachments/download/1/shared.bin"
+
+	digest, _, err := s.Store.StoreStream(strings.NewReader("shared content"), 0)
+	if err != nil {
+		t.Fatalf("StoreStream: %s", err)
+	}
+	dl := &inflightDownload{digest: digest}
+	s.inflight[link] = dl
+
+	if err := s.downloadAttachment(link, 2, 0); err != nil {
+		t.Fatalf("downloadAttachment (waiter): %s", err)
+	}
+
+	linkPath := filepath.Join(s.SyncDir, "2", "1", "shared.bin")
+	b, err := os.ReadFile(linkPath)
+	if err != nil {
+		t.Fatalf("reading through waiter's own symlink: %s", err)
+	}
+	if string(b) != "shared content" {
+		t.Fatalf("content through waiter's symlink = %q, want %q", b, "shared content")
+	}
+}
+
+func TestDownloadAttachmentWaiterSkipsOnErrSkip(t *testing.T) {
+	s := newTestSyncer(t)
+	const link = "http://example.invalid/attachments/download/1/gone.bin"
+
+	dl := &inflightDownload{err: errSkip}
+	s.inflight[link] = dl
+
+	if err := s.downloadAttachment(link, 2, 0); err != nil {
+		t.Fatalf("downloadAttachment (waiter) on errSkip = %v, want nil", err)
+	}
+
+	linkPath := filepath.Join(s.SyncDir, "2", "1", "gone.bin")
+	if _, err := os.Lstat(linkPath); err == nil {
+		t.Fatalf("waiter created a symlink for a skipped (404/403) attachment")
+	}
+}
+
+func TestDownloadAttachmentWaiterPropagatesWinnerError(t *testing.T) {
+	s := newTestSyncer(t)
+	const link = "http://example.invalid/attachments/download/1/broken.bin"
+
+	dl := &inflightDownload{err: errIncomplete}
+	s.inflight[link] = dl
+
+	if err := s.downloadAttachment(link, 2, 0); err != errIncomplete {
+		t.Fatalf("downloadAttachment (waiter) = %v, want errIncomplete", err)
+	}
+}